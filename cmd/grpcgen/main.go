@@ -0,0 +1,30 @@
+// Command grpcgen is the CLI front-end for the grpcgen library: it loads
+// each package directory given on the command line and runs the requested
+// generator plugins against it.
+package main
+
+import (
+	"flag"
+	"log"
+	"strings"
+
+	"github.com/tommady/grpcGen"
+)
+
+var (
+	pluginNames   = flag.String("plugins", "proto", "comma-separated list of registered grpcgen plugins to run, e.g. proto,docs")
+	enableGateway = flag.Bool("gateway", true, "emit a grpc-gateway reverse proxy for services carrying @grpcGen:HTTP annotations")
+	enableOpenAPI = flag.Bool("openapi", true, "emit an OpenAPI v2 spec for services carrying @grpcGen:HTTP annotations")
+)
+
+func main() {
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+	log.SetPrefix("grpcGen: ")
+	flag.Parse()
+	names := strings.Split(*pluginNames, ",")
+	for _, pkgDir := range flag.Args() {
+		if err := grpcgen.Generate(pkgDir, names, *enableGateway, *enableOpenAPI); err != nil {
+			log.Fatalln(err)
+		}
+	}
+}
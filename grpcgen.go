@@ -0,0 +1,1125 @@
+// Package grpcgen turns annotated Go source into a .proto file and its
+// generated gRPC stubs. The default pipeline lives behind the "proto"
+// plugin; import this package and call RegisterPlugin to add your own
+// generators (TypeScript clients, mock servers, OpenAPI, ...) alongside it.
+package grpcgen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"golang.org/x/tools/go/packages"
+)
+
+const (
+	msgSymbol         = "@grpcGen:Message"
+	msgReservedSymbol = "@grpcGen:Reserved:"
+	fieldOneofSymbol  = "@grpcGen:Oneof:"
+	fieldOptSymbol    = "@grpcGen:Optional"
+	srvSymbol         = "@grpcGen:Service"
+	srvNameSymbol     = "@grpcGen:SrvName:"
+	srvStreamSymbol   = "@grpcGen:Stream:"
+	srvHTTPSymbol     = "@grpcGen:HTTP:"
+	srvParamSymbol    = "*pb."
+	srvRetSymbol      = "*pb."
+)
+
+var httpMethods = map[string]bool{
+	"GET":    true,
+	"POST":   true,
+	"PUT":    true,
+	"DELETE": true,
+	"PATCH":  true,
+}
+
+// streaming modes recognized after srvStreamSymbol.
+const (
+	streamModeServer = "server"
+	streamModeClient = "client"
+	streamModeBidi   = "bidi"
+)
+
+// OutTemplatData is the layout proto file template's data.
+type OutTemplatData struct {
+	PackageName string
+	Messages    map[string]*Msg
+	Services    map[string][]*SrvFunc
+	HasHTTP     bool
+}
+
+// Msg stands for every declaration in gRPC Message type.
+type Msg struct {
+	Name    string
+	Members []*MsgMember
+	// Reserved holds the field-number ranges declared via
+	// @grpcGen:Reserved:, emitted as `reserved ...;` so a field can be
+	// dropped without its old wire number ever being reused.
+	Reserved []ReservedRange
+}
+
+// ReservedRange is one `@grpcGen:Reserved:` entry, e.g. "4" or "6-8". Its
+// String method renders proto3's `reserved` syntax ("4" or "6 to 8").
+type ReservedRange struct {
+	Lo int
+	Hi int
+}
+
+func (r ReservedRange) String() string {
+	if r.Lo == r.Hi {
+		return strconv.Itoa(r.Lo)
+	}
+	return fmt.Sprintf("%d to %d", r.Lo, r.Hi)
+}
+
+// MsgMember is the gRPC Message type's member.
+type MsgMember struct {
+	Name string
+	Type string
+	// Expr is the original Go type expression, kept alongside Type so
+	// correctTypes can walk it structurally instead of re-parsing a string.
+	Expr ast.Expr
+	// Tag is the proto3 field number. It comes from a `pb:"N"` struct tag
+	// when present, and is otherwise auto-assigned by assignFieldTags.
+	Tag int
+	// Deprecated marks the field with `[deprecated=true]`, set via a
+	// `pb:"N,deprecated"` struct tag.
+	Deprecated bool
+	// OneofGroup names the `oneof` block this field belongs to, set via a
+	// `// @grpcGen:Oneof: <name>` doc comment. Empty means a plain field.
+	OneofGroup string
+	// Optional marks the field with proto3's explicit `optional` keyword,
+	// set via a `// @grpcGen:Optional` doc comment.
+	Optional bool
+}
+
+// OneofGroup is a named group of MsgMembers rendered as a single `oneof`
+// block, built from the members sharing an OneofGroup by the oneofGroups
+// template helper.
+type OneofGroup struct {
+	Name    string
+	Members []*MsgMember
+}
+
+// Srv stands for every RPC mapping function in gRPC Service type.
+type Srv struct {
+	Name  string
+	Funcs *SrvFunc
+}
+
+// SrvFunc is the gRPC Service type's function member.
+type SrvFunc struct {
+	Name      string
+	In        string
+	Out       string
+	InStream  bool
+	OutStream bool
+	HTTP      *HTTPRule
+}
+
+// HTTPRule is a `google.api.http` binding parsed from an @grpcGen:HTTP
+// annotation, letting protoc-gen-grpc-gateway front the RPC with REST/JSON.
+type HTTPRule struct {
+	Method   string
+	Pattern  string
+	Body     string
+	Segments []PathSegment
+}
+
+// PathSegment is one "/"-delimited piece of an HTTP path template, following
+// grpc-gateway's grammar: a literal, a `{var}` capture, or a `{var=**}`
+// catch-all.
+type PathSegment struct {
+	Literal  string
+	Var      string
+	CatchAll bool
+}
+
+// Generator holds one package's messages and services after AST loading.
+// It is what every registered Plugin receives.
+type Generator struct {
+	Fset        *token.FileSet
+	PackageName string
+	Dir         string
+	OutPath     string
+	Files       []string
+	Messages    map[string]*Msg
+	Services    map[string][]*SrvFunc
+	// Gateway and OpenAPI control whether the built-in "proto" plugin also
+	// shells out to protoc-gen-grpc-gateway / protoc-gen-openapiv2 for
+	// services carrying @grpcGen:HTTP annotations.
+	Gateway bool
+	OpenAPI bool
+}
+
+// Plugin is a named code generator that consumes a loaded Generator, e.g. to
+// emit a .proto file, a Markdown reference, or a client SDK.
+type Plugin func(*Generator) error
+
+var plugins = map[string]Plugin{
+	"proto": protoPlugin,
+	"docs":  docsPlugin,
+}
+
+// RegisterPlugin makes a Plugin available to Generate under name, replacing
+// any plugin already registered with that name. Programs that import
+// grpcgen as a library call this from an init() to add generators beyond
+// the built-in "proto" and "docs".
+func RegisterPlugin(name string, fn Plugin) {
+	plugins[name] = fn
+}
+
+// Generate loads the package rooted at pkgDir and runs each named plugin
+// against it in order.
+func Generate(pkgDir string, pluginNames []string, gateway, openAPI bool) error {
+	gen, err := loadGenerator(pkgDir)
+	if err != nil {
+		return err
+	}
+	gen.Gateway = gateway
+	gen.OpenAPI = openAPI
+	for _, name := range pluginNames {
+		fn, ok := plugins[name]
+		if !ok {
+			return fmt.Errorf("unknown plugin %q", name)
+		}
+		if err := fn(gen); err != nil {
+			return fmt.Errorf("plugin %q: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// loadGenerator loads every Go file under pkgDir as a single package,
+// resolves messages and services across all of them, and returns the
+// Generator plugins run against.
+func loadGenerator(pkgDir string) (*Generator, error) {
+	msgs := make(map[string]*Msg)
+	srvs := make(map[string][]*SrvFunc)
+	fset, pkgName, files, paths, err := loadPackage(pkgDir)
+	if err != nil {
+		return nil, err
+	}
+	outPath, err := getOutPath(pkgDir, pkgName)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 1 && len(files[0].Decls) == 0 {
+		createProtoFile(outPath, pkgName, msgs, srvs, false)
+		outExampleOnSource(paths[0])
+		return nil, fmt.Errorf("no declaration exists, going to generate example")
+	}
+	for _, f := range files {
+		for i, decl := range f.Decls {
+			if genDecl, ok := decl.(*ast.GenDecl); ok {
+				if genDecl.Doc == nil {
+					continue
+				}
+				if msg, err := fetchMsg(genDecl); err == nil {
+					if msg != nil {
+						msgs[msg.Name] = msg
+					}
+				} else {
+					log.Printf("decl[%d] fetchMsg fail:%q", i, err)
+				}
+			} else if funcDecl, ok := decl.(*ast.FuncDecl); ok {
+				if funcDecl.Doc == nil {
+					continue
+				}
+				if srv, err := fetchSrv(funcDecl); err == nil {
+					if srv != nil {
+						srvs[srv.Name] = append(srvs[srv.Name], srv.Funcs)
+					}
+				} else {
+					log.Printf("decl[%d] fetchSrv fail:%q", i, err)
+				}
+			} else {
+				log.Printf("decl[%d] cannot be converted into FuncDecl or genDecl", i)
+			}
+		}
+	}
+	if len(msgs) == 0 {
+		return nil, fmt.Errorf("%s symbol cannot be found", msgSymbol)
+	}
+	if len(srvs) == 0 {
+		return nil, fmt.Errorf("%s symbol cannot be found", srvSymbol)
+	}
+	if err := correctTypes(msgs); err != nil {
+		return nil, err
+	}
+	if err := assignFieldTags(msgs); err != nil {
+		return nil, err
+	}
+	if err := resolveReferences(fset, files, msgs, srvs); err != nil {
+		return nil, err
+	}
+	if err := validateHTTPRules(msgs, srvs); err != nil {
+		return nil, err
+	}
+	return &Generator{
+		Fset:        fset,
+		PackageName: pkgName,
+		Dir:         pkgDir,
+		OutPath:     outPath,
+		Files:       paths,
+		Messages:    msgs,
+		Services:    srvs,
+	}, nil
+}
+
+// protoPlugin is the built-in "proto" generator: it emits the package's
+// .go.proto, shells out to protoc, and comments out the @grpcGen:Message
+// declarations it processed so a re-run doesn't reprocess them.
+func protoPlugin(gen *Generator) error {
+	hasHTTP := false
+	for _, funcs := range gen.Services {
+		for _, fn := range funcs {
+			if fn.HTTP != nil {
+				hasHTTP = true
+			}
+		}
+	}
+	if err := createProtoFile(gen.OutPath, gen.PackageName, gen.Messages, gen.Services, hasHTTP); err != nil {
+		return err
+	}
+	if err := callProtoc(gen.OutPath, hasHTTP && gen.Gateway, hasHTTP && gen.OpenAPI); err != nil {
+		return err
+	}
+	for _, path := range gen.Files {
+		if err := markMsgAsComment(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// docsPlugin is the built-in "docs" generator: it dumps a Markdown
+// reference of every service and message in the package next to the
+// generated .go.proto.
+func docsPlugin(gen *Generator) error {
+	out := filepath.Join(filepath.Dir(gen.OutPath), gen.PackageName+".md")
+	if err := os.MkdirAll(filepath.Dir(out), 0777); err != nil {
+		return err
+	}
+	outFile, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer outFile.Close()
+	fmt.Fprintf(outFile, "# %s\n\n## Services\n\n", gen.PackageName)
+	for name, funcs := range gen.Services {
+		fmt.Fprintf(outFile, "### %s\n\n| RPC | Request | Response |\n|---|---|---|\n", name)
+		for _, fn := range funcs {
+			in, out := fn.In, fn.Out
+			if fn.InStream {
+				in = "stream " + in
+			}
+			if fn.OutStream {
+				out = "stream " + out
+			}
+			fmt.Fprintf(outFile, "| %s | %s | %s |\n", fn.Name, in, out)
+		}
+		fmt.Fprintln(outFile)
+	}
+	fmt.Fprintf(outFile, "## Messages\n\n")
+	for name, msg := range gen.Messages {
+		fmt.Fprintf(outFile, "### %s\n\n| Field | Type |\n|---|---|\n", name)
+		for _, m := range msg.Members {
+			fmt.Fprintf(outFile, "| %s | %s |\n", m.Name, m.Type)
+		}
+		fmt.Fprintln(outFile)
+	}
+	return nil
+}
+
+// loadPackage parses every Go file under pkgDir as a single package via
+// golang.org/x/tools/go/packages, the same way govpp's binapigen loads a
+// package before generating code. It returns the shared fset (needed to
+// report file/line diagnostics), the package name, and its files in the
+// same order as their source paths.
+func loadPackage(pkgDir string) (fset *token.FileSet, pkgName string, files []*ast.File, paths []string, err error) {
+	fset = token.NewFileSet()
+	cfg := &packages.Config{
+		Mode: packages.NeedName | packages.NeedCompiledGoFiles | packages.NeedSyntax,
+		Dir:  pkgDir,
+		Fset: fset,
+		ParseFile: func(fset *token.FileSet, filename string, src []byte) (*ast.File, error) {
+			return parser.ParseFile(fset, filename, src, parser.ParseComments)
+		},
+	}
+	pkgs, err := packages.Load(cfg, ".")
+	if err != nil {
+		return nil, "", nil, nil, err
+	}
+	if len(pkgs) == 0 {
+		return nil, "", nil, nil, fmt.Errorf("no package found in %s", pkgDir)
+	}
+	pkg := pkgs[0]
+	if len(pkg.Errors) > 0 {
+		return nil, "", nil, nil, fmt.Errorf("%s: %s", pkgDir, pkg.Errors[0])
+	}
+	return fset, pkg.Name, pkg.Syntax, pkg.CompiledGoFiles, nil
+}
+
+// resolveReferences confirms every SrvFunc's In/Out message name resolves to
+// a message declared somewhere in the package, reporting the offending
+// function's file:line via fset when it doesn't.
+func resolveReferences(fset *token.FileSet, files []*ast.File, msgs map[string]*Msg, srvs map[string][]*SrvFunc) error {
+	for _, funcs := range srvs {
+		for _, fn := range funcs {
+			for _, name := range []string{fn.In, fn.Out} {
+				if name == "" {
+					continue
+				}
+				if _, ok := msgs[name]; !ok {
+					return fmt.Errorf("%s: %s references unknown message %q, declare it with %s",
+						fset.Position(findFuncPos(files, fn.Name)), fn.Name, name, msgSymbol)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// findFuncPos returns the position of the function named name among files.
+func findFuncPos(files []*ast.File, name string) token.Pos {
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			if funcDecl, ok := decl.(*ast.FuncDecl); ok && funcDecl.Name.Name == name {
+				return funcDecl.Pos()
+			}
+		}
+	}
+	return token.NoPos
+}
+
+func fetchMsg(genDecl *ast.GenDecl) (*Msg, error) {
+	if genDecl.Doc == nil {
+		return nil, fmt.Errorf("genDecl.Doc is nil")
+	}
+	msg := new(Msg)
+	found := false
+	for _, comment := range genDecl.Doc.List {
+		switch {
+		case strings.Contains(comment.Text, msgSymbol):
+			found = true
+		case strings.Contains(comment.Text, msgReservedSymbol):
+			ranges, err := parseReservedRanges(comment.Text)
+			if err != nil {
+				return nil, err
+			}
+			msg.Reserved = append(msg.Reserved, ranges...)
+		}
+	}
+	if !found {
+		return nil, nil
+	}
+	for _, spec := range genDecl.Specs {
+		typeSpec, ok := spec.(*ast.TypeSpec)
+		if !ok {
+			return nil, fmt.Errorf("fail to convert into ast.TypeSpec")
+		}
+		if typeSpec.Name == nil {
+			return nil, fmt.Errorf("typeSpec.Name is nil")
+		}
+		msg.Name = typeSpec.Name.Name
+		struc := typeSpec.Type.(*ast.StructType)
+		for _, s := range struc.Fields.List {
+			memb := new(MsgMember)
+			memb.Type = types.ExprString(s.Type)
+			memb.Expr = s.Type
+			for _, name := range s.Names {
+				if name != nil {
+					memb.Name = name.Name
+				}
+			}
+			if err := parseFieldTag(s, memb); err != nil {
+				return nil, err
+			}
+			parseFieldDoc(s, memb)
+			msg.Members = append(msg.Members, memb)
+		}
+	}
+	return msg, nil
+}
+
+// parseReservedRanges parses an @grpcGen:Reserved: doc comment, e.g.
+// `// @grpcGen:Reserved: 4,6-8`, into its field-number ranges.
+func parseReservedRanges(text string) ([]ReservedRange, error) {
+	rest := strings.TrimPrefix(text, "// "+msgReservedSymbol)
+	rest = strings.TrimPrefix(rest, "//"+msgReservedSymbol)
+	var ranges []ReservedRange
+	for _, tok := range strings.Split(rest, ",") {
+		tok = strings.TrimSpace(tok)
+		if tok == "" {
+			continue
+		}
+		if lo, hi, ok := strings.Cut(tok, "-"); ok {
+			loN, err := strconv.Atoi(strings.TrimSpace(lo))
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s range %q: %s", msgReservedSymbol, tok, err)
+			}
+			hiN, err := strconv.Atoi(strings.TrimSpace(hi))
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s range %q: %s", msgReservedSymbol, tok, err)
+			}
+			ranges = append(ranges, ReservedRange{Lo: loN, Hi: hiN})
+			continue
+		}
+		n, err := strconv.Atoi(tok)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value %q: %s", msgReservedSymbol, tok, err)
+		}
+		ranges = append(ranges, ReservedRange{Lo: n, Hi: n})
+	}
+	return ranges, nil
+}
+
+// parseFieldTag reads field's `pb:"N"` / `pb:"N,deprecated"` struct tag,
+// if any, populating memb.Tag and memb.Deprecated.
+func parseFieldTag(field *ast.Field, memb *MsgMember) error {
+	if field.Tag == nil {
+		return nil
+	}
+	tagStr, err := strconv.Unquote(field.Tag.Value)
+	if err != nil {
+		return fmt.Errorf("field %s: invalid struct tag %s: %s", memb.Name, field.Tag.Value, err)
+	}
+	pbTag, ok := reflect.StructTag(tagStr).Lookup("pb")
+	if !ok {
+		return nil
+	}
+	parts := strings.Split(pbTag, ",")
+	if num := strings.TrimSpace(parts[0]); num != "" {
+		n, err := strconv.Atoi(num)
+		if err != nil {
+			return fmt.Errorf("field %s: pb tag %q has a non-numeric field number", memb.Name, pbTag)
+		}
+		memb.Tag = n
+	}
+	for _, opt := range parts[1:] {
+		if strings.TrimSpace(opt) == "deprecated" {
+			memb.Deprecated = true
+		}
+	}
+	return nil
+}
+
+// parseFieldDoc reads field's doc comment for @grpcGen:Oneof: and
+// @grpcGen:Optional annotations, populating memb.OneofGroup/memb.Optional.
+func parseFieldDoc(field *ast.Field, memb *MsgMember) {
+	if field.Doc == nil {
+		return
+	}
+	for _, c := range field.Doc.List {
+		switch {
+		case strings.Contains(c.Text, fieldOneofSymbol):
+			group := strings.TrimPrefix(c.Text, "// "+fieldOneofSymbol)
+			group = strings.TrimPrefix(group, "//"+fieldOneofSymbol)
+			memb.OneofGroup = strings.Trim(group, " ")
+		case strings.Contains(c.Text, fieldOptSymbol):
+			memb.Optional = true
+		}
+	}
+}
+
+// fetchSrv parses funcDecl's doc comments and signature into a Srv.
+// Streaming is recognized two ways, both paired with @grpcGen:Stream:
+//   - a chan<-/<-chan parameter, whose *pb. element supplies the message
+//     name directly; and
+//   - a hand-written stream stub parameter such as pb.Foo_SubServer, the
+//     shape protoc-gen-go-grpc actually generates. The stub carries no
+//     resolvable message type of its own -- the pb package it would resolve
+//     against doesn't exist until this generator produces it -- so the
+//     message name(s) it streams must be given as extra words after the
+//     mode, e.g. "@grpcGen:Stream: server Reply".
+func fetchSrv(funcDecl *ast.FuncDecl) (*Srv, error) {
+	if funcDecl.Doc == nil {
+		return nil, fmt.Errorf("funcDecl.Doc is nil")
+	}
+	srv := new(Srv)
+	foundSrv := false
+	foundSrvName := false
+	streamMode := ""
+	var streamMsgs []string
+	var httpRule *HTTPRule
+	for _, comment := range funcDecl.Doc.List {
+		if foundSrv && foundSrvName {
+			break
+		}
+		if strings.Contains(comment.Text, srvStreamSymbol) {
+			mode := strings.TrimPrefix(comment.Text, "// "+srvStreamSymbol)
+			mode = strings.TrimPrefix(mode, "//"+srvStreamSymbol)
+			fields := strings.Fields(mode)
+			if len(fields) > 0 {
+				streamMode = strings.ToLower(fields[0])
+				streamMsgs = fields[1:]
+			}
+		} else if strings.Contains(comment.Text, srvHTTPSymbol) {
+			rule, err := parseHTTPRule(comment.Text)
+			if err != nil {
+				return nil, err
+			}
+			httpRule = rule
+		} else if strings.Contains(comment.Text, srvSymbol) {
+			foundSrv = true
+			fun := new(SrvFunc)
+			fun.Name = funcDecl.Name.Name
+			fun.HTTP = httpRule
+			switch streamMode {
+			case streamModeServer:
+				fun.OutStream = true
+			case streamModeClient:
+				fun.InStream = true
+			case streamModeBidi:
+				fun.InStream = true
+				fun.OutStream = true
+			}
+			for _, param := range funcDecl.Type.Params.List {
+				strType := types.ExprString(param.Type)
+				switch {
+				case strings.HasPrefix(strType, "<-chan "+srvParamSymbol):
+					fun.In = strings.TrimPrefix(strType, "<-chan "+srvParamSymbol)
+					fun.InStream = true
+				case strings.HasPrefix(strType, "chan<- "+srvParamSymbol):
+					fun.Out = strings.TrimPrefix(strType, "chan<- "+srvParamSymbol)
+					fun.OutStream = true
+				case strings.HasPrefix(strType, srvParamSymbol):
+					fun.In = strings.TrimPrefix(strType, srvParamSymbol)
+				case isStreamStub(strType):
+					// Carries no parseable message type; filled in below
+					// from streamMsgs.
+				}
+			}
+			for _, ret := range funcDecl.Type.Results.List {
+				strType := types.ExprString(ret.Type)
+				if strings.Contains(strType, srvParamSymbol) {
+					fun.Out = strings.TrimPrefix(strType, srvParamSymbol)
+				}
+			}
+			if fun.InStream && fun.In == "" {
+				if len(streamMsgs) == 0 {
+					return nil, fmt.Errorf(
+						"%s: %s%s needs the request message name, e.g. %q, since no <-chan or *pb. parameter supplies it",
+						fun.Name, srvStreamSymbol, streamMode, "@grpcGen:Stream: "+streamMode+" Request",
+					)
+				}
+				fun.In, streamMsgs = streamMsgs[0], streamMsgs[1:]
+			}
+			if fun.OutStream && fun.Out == "" {
+				if len(streamMsgs) == 0 {
+					return nil, fmt.Errorf(
+						"%s: %s%s needs the reply message name, e.g. %q, since no chan<- parameter or *pb. return value supplies it",
+						fun.Name, srvStreamSymbol, streamMode, "@grpcGen:Stream: "+streamMode+" Reply",
+					)
+				}
+				fun.Out = streamMsgs[0]
+			}
+			srv.Funcs = fun
+		} else if strings.Contains(comment.Text, srvNameSymbol) {
+			foundSrvName = true
+			if srv.Name == "" {
+				srv.Name = strings.TrimPrefix(comment.Text, "// "+srvNameSymbol)
+				srv.Name = strings.TrimPrefix(srv.Name, "//"+srvNameSymbol)
+				srv.Name = strings.Trim(srv.Name, " ")
+			}
+		}
+	}
+	if foundSrv && foundSrvName {
+		return srv, nil
+	}
+	return nil, nil
+}
+
+// isStreamStub reports whether strType looks like a generated stream stub,
+// e.g. `pb.Foo_SubServer`, as opposed to a plain message type.
+func isStreamStub(strType string) bool {
+	return strings.HasSuffix(strType, "Server") || strings.HasSuffix(strType, "Client")
+}
+
+// parseHTTPRule parses an @grpcGen:HTTP doc comment, e.g.
+// `// @grpcGen:HTTP: GET /v1/greet/{name}` or
+// `// @grpcGen:HTTP: POST /v1/greet Body: *`.
+func parseHTTPRule(text string) (*HTTPRule, error) {
+	rest := strings.TrimPrefix(text, "// "+srvHTTPSymbol)
+	rest = strings.TrimPrefix(rest, "//"+srvHTTPSymbol)
+	fields := strings.Fields(rest)
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("malformed %s annotation: %q", srvHTTPSymbol, text)
+	}
+	method := strings.ToUpper(fields[0])
+	if !httpMethods[method] {
+		return nil, fmt.Errorf("unsupported HTTP method %q in %q", fields[0], text)
+	}
+	segments, err := parsePathTemplate(fields[1])
+	if err != nil {
+		return nil, err
+	}
+	rule := &HTTPRule{Method: method, Pattern: fields[1], Segments: segments}
+	for i := 2; i+1 < len(fields); i++ {
+		if fields[i] == "Body:" {
+			rule.Body = fields[i+1]
+		}
+	}
+	return rule, nil
+}
+
+// parsePathTemplate compiles an HTTP path template into its segments,
+// following the grammar grpc-gateway uses: "/"-delimited static literals,
+// `{var}` captures, and a trailing `{var=**}` catch-all.
+func parsePathTemplate(pattern string) ([]PathSegment, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return nil, fmt.Errorf("path template %q must start with /", pattern)
+	}
+	parts := strings.Split(strings.TrimPrefix(pattern, "/"), "/")
+	segments := make([]PathSegment, 0, len(parts))
+	for i, part := range parts {
+		if !strings.HasPrefix(part, "{") || !strings.HasSuffix(part, "}") {
+			segments = append(segments, PathSegment{Literal: part})
+			continue
+		}
+		inner := strings.TrimSuffix(strings.TrimPrefix(part, "{"), "}")
+		name := inner
+		catchAll := false
+		if idx := strings.Index(inner, "="); idx >= 0 {
+			name = inner[:idx]
+			if inner[idx+1:] != "**" {
+				return nil, fmt.Errorf("path template %q: unsupported verb %q, only ** catch-alls are supported", pattern, inner[idx+1:])
+			}
+			catchAll = true
+		}
+		if name == "" {
+			return nil, fmt.Errorf("path template %q has an empty variable name", pattern)
+		}
+		if catchAll && i != len(parts)-1 {
+			return nil, fmt.Errorf("path template %q: catch-all %q must be the last segment", pattern, part)
+		}
+		segments = append(segments, PathSegment{Var: name, CatchAll: catchAll})
+	}
+	return segments, nil
+}
+
+// validateHTTPRules confirms every {var} in an HTTP path template names a
+// scalar field on the RPC's request message.
+func validateHTTPRules(msgs map[string]*Msg, srvs map[string][]*SrvFunc) error {
+	for _, funcs := range srvs {
+		for _, fn := range funcs {
+			if fn.HTTP == nil {
+				continue
+			}
+			msg, ok := msgs[fn.In]
+			if !ok {
+				return fmt.Errorf("%s: %s references unknown message %q", fn.Name, fn.HTTP.Pattern, fn.In)
+			}
+			for _, seg := range fn.HTTP.Segments {
+				if seg.Var == "" {
+					continue
+				}
+				member := findMsgMember(msg.Members, seg.Var)
+				if member == nil {
+					return fmt.Errorf("%s: %s references field %q not found on %s", fn.Name, fn.HTTP.Pattern, seg.Var, fn.In)
+				}
+				if strings.HasPrefix(member.Type, "repeated ") || strings.HasPrefix(member.Type, "map<") {
+					return fmt.Errorf("%s: %s field %q must be a scalar type to appear in a path template", fn.Name, fn.HTTP.Pattern, seg.Var)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// findMsgMember returns the member named name, or nil if none matches.
+func findMsgMember(members []*MsgMember, name string) *MsgMember {
+	for _, m := range members {
+		if m.Name == name {
+			return m
+		}
+	}
+	return nil
+}
+
+// getOutPath returns the single .go.proto path generated for the package
+// named pkgName rooted at dir.
+func getOutPath(dir, pkgName string) (string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(absDir, "/pb", fmt.Sprintf("%s.go.proto", pkgName)), nil
+}
+
+func markMsgAsComment(path string) error {
+	if path == "" {
+		return fmt.Errorf("File does not exist")
+	}
+	in, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(string(in), "\n")
+	for i := 0; i < len(lines); i++ {
+		if strings.Contains(lines[i], msgSymbol) {
+			for j := i + 1; ; j++ {
+				if !strings.HasPrefix(lines[j], "//") {
+					lines[j] = "// " + lines[j]
+				}
+				if strings.Contains(lines[j], "}") {
+					i = j
+					break
+				}
+			}
+		}
+	}
+	out := strings.Join(lines, "\n")
+	err = ioutil.WriteFile(path, []byte(out), 0644)
+	if err != nil {
+		return nil
+	}
+	return nil
+}
+
+func createProtoFile(path, packageName string, msgs map[string]*Msg, srvs map[string][]*SrvFunc, hasHTTP bool) error {
+	// "/pb" foder does not exist, create it
+	if _, err := os.Stat(filepath.Dir(path)); err != nil {
+		if err := os.Mkdir("pb", 0777); err != nil {
+			return err
+		}
+	}
+	// protobuf file existed, delete it
+	if _, err := os.Stat(path); err == nil {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	outFile, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0777)
+	if err != nil {
+		return err
+	}
+	defer outFile.Close()
+	outData := new(OutTemplatData)
+	outData.Messages = msgs
+	outData.Services = srvs
+	outData.PackageName = packageName
+	outData.HasHTTP = hasHTTP
+	tmplFuncs := template.FuncMap{
+		"lower":       strings.ToLower,
+		"plainFields": plainFields,
+		"oneofGroups": oneofGroups,
+	}
+	outTmpl := template.Must(template.New("outProto").Funcs(tmplFuncs).Parse(getTemplateText()))
+	if err := outTmpl.Execute(outFile, outData); err != nil {
+		return err
+	}
+	return nil
+}
+
+// callProtoc invokes protoc to generate the gRPC stubs, optionally adding
+// protoc-gen-grpc-gateway and protoc-gen-openapiv2 outputs for services
+// carrying @grpcGen:HTTP annotations.
+func callProtoc(path string, withGateway, withOpenAPI bool) error {
+	if !strings.HasSuffix(path, ".go.proto") {
+		return fmt.Errorf("path %s doesn't have .go.proto extension", path)
+	}
+	trimmed := strings.TrimSuffix(path, ".go.proto")
+	dir, _ := filepath.Split(trimmed)
+	cmd := "protoc"
+	args := []string{"-I", dir, path, fmt.Sprintf("--go_out=plugins=grpc:%s", dir)}
+	if withGateway {
+		args = append(args, fmt.Sprintf("--grpc-gateway_out=logtostderr=true:%s", dir))
+	}
+	if withOpenAPI {
+		args = append(args, fmt.Sprintf("--openapiv2_out=logtostderr=true:%s", dir))
+	}
+	cmdProc := exec.Command(cmd, args...)
+	var stderr bytes.Buffer
+	cmdProc.Stderr = &stderr
+	if err := cmdProc.Run(); err != nil {
+		return fmt.Errorf("%s", stderr.String())
+	}
+	return nil
+}
+
+func outExampleOnSource(path string) error {
+	if path == "" {
+		return fmt.Errorf("File does not exist")
+	}
+	if !strings.HasSuffix(path, ".go") {
+		return fmt.Errorf("path %s doesn't have .go extension", path)
+	}
+	in, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(string(in), "\n")
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	exLines := strings.Split(getExampleText(strings.Split(dir, "/src/")[1]), "\n")
+	lines = append(lines, exLines...)
+	out := strings.Join(lines, "\n")
+	err = ioutil.WriteFile(path, []byte(out), 0644)
+	if err != nil {
+		return nil
+	}
+	return nil
+}
+
+// scalarTypes maps Go's predeclared scalar identifiers to their proto3
+// Scalar Value Type equivalents:
+// https://developers.google.com/protocol-buffers/docs/proto3#scalar
+var scalarTypes = map[string]string{
+	"int":     "int32",
+	"int8":    "int32",
+	"int16":   "int32",
+	"int32":   "int32",
+	"int64":   "int64",
+	"uint":    "uint32",
+	"uint8":   "uint32",
+	"uint16":  "uint32",
+	"uint32":  "uint32",
+	"uint64":  "uint64",
+	"float32": "float",
+	"float64": "double",
+	"bool":    "bool",
+	"string":  "string",
+}
+
+// correctTypes walks each member's ast.Expr recursively and rewrites its
+// Type into the proto3 equivalent.
+func correctTypes(msgs map[string]*Msg) error {
+	if msgs == nil {
+		return fmt.Errorf("input msgs is nil")
+	}
+	for _, msg := range msgs {
+		for _, member := range msg.Members {
+			t, err := protoType(member.Expr, false)
+			if err != nil {
+				return fmt.Errorf("member %s: %s", member.Name, err)
+			}
+			member.Type = t
+		}
+	}
+	return nil
+}
+
+// assignFieldTags resolves every message's field numbers: it validates the
+// explicit tags set via `pb:"N"` struct tags against collisions with each
+// other and with @grpcGen:Reserved: ranges, then auto-assigns the lowest
+// free number to every field left untagged.
+func assignFieldTags(msgs map[string]*Msg) error {
+	for _, msg := range msgs {
+		used := make(map[int]string, len(msg.Members))
+		for _, member := range msg.Members {
+			if member.Tag == 0 {
+				continue
+			}
+			if reservedContains(msg.Reserved, member.Tag) {
+				return fmt.Errorf("message %s: field %s uses tag %d which is reserved", msg.Name, member.Name, member.Tag)
+			}
+			if other, ok := used[member.Tag]; ok {
+				return fmt.Errorf("message %s: fields %s and %s both use tag %d", msg.Name, other, member.Name, member.Tag)
+			}
+			used[member.Tag] = member.Name
+		}
+		next := 1
+		for _, member := range msg.Members {
+			if member.Tag != 0 {
+				continue
+			}
+			for {
+				if _, taken := used[next]; !taken && !reservedContains(msg.Reserved, next) {
+					break
+				}
+				next++
+			}
+			member.Tag = next
+			used[next] = member.Name
+		}
+	}
+	return nil
+}
+
+// reservedContains reports whether n falls inside any of ranges.
+func reservedContains(ranges []ReservedRange, n int) bool {
+	for _, r := range ranges {
+		if n >= r.Lo && n <= r.Hi {
+			return true
+		}
+	}
+	return false
+}
+
+// plainFields returns members not belonging to a oneof group, in
+// declaration order, for the template's top-level field list.
+func plainFields(members []*MsgMember) []*MsgMember {
+	var out []*MsgMember
+	for _, m := range members {
+		if m.OneofGroup == "" {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// oneofGroups collects members into OneofGroups, in first-appearance order,
+// for the template to render as `oneof <name> { ... }` blocks.
+func oneofGroups(members []*MsgMember) []*OneofGroup {
+	var groups []*OneofGroup
+	byName := make(map[string]*OneofGroup)
+	for _, m := range members {
+		if m.OneofGroup == "" {
+			continue
+		}
+		g, ok := byName[m.OneofGroup]
+		if !ok {
+			g = &OneofGroup{Name: m.OneofGroup}
+			byName[m.OneofGroup] = g
+			groups = append(groups, g)
+		}
+		g.Members = append(g.Members, m)
+	}
+	return groups
+}
+
+// protoType descends expr, translating it into its proto3 counterpart.
+// repeated reports whether expr already sits inside a repeated field, since
+// proto3 forbids repeated-of-repeated.
+func protoType(expr ast.Expr, repeated bool) (string, error) {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return protoType(t.X, repeated)
+	case *ast.ArrayType:
+		if ident, ok := t.Elt.(*ast.Ident); ok && ident.Name == "byte" {
+			return "bytes", nil
+		}
+		if repeated {
+			return "", fmt.Errorf(
+				"nested %s is repeated-of-repeated, proto3 forbids this; wrap it in a message",
+				types.ExprString(expr),
+			)
+		}
+		elem, err := protoType(t.Elt, true)
+		if err != nil {
+			return "", err
+		}
+		return "repeated " + elem, nil
+	case *ast.MapType:
+		if repeated {
+			return "", fmt.Errorf(
+				"nested %s is a map inside a repeated field or another map, proto3 forbids this; wrap it in a message",
+				types.ExprString(expr),
+			)
+		}
+		if _, ok := t.Key.(*ast.Ident); !ok {
+			return "", fmt.Errorf("map key %s must be a scalar type per proto3 rules", types.ExprString(t.Key))
+		}
+		key, err := protoType(t.Key, repeated)
+		if err != nil {
+			return "", err
+		}
+		if key == "float" || key == "double" {
+			return "", fmt.Errorf("map key %s must be a scalar type per proto3 rules", key)
+		}
+		value, err := protoType(t.Value, true)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("map<%s, %s>", key, value), nil
+	case *ast.InterfaceType:
+		return "google.protobuf.Value", nil
+	case *ast.SelectorExpr:
+		return t.Sel.Name, nil
+	case *ast.Ident:
+		if scalar, ok := scalarTypes[t.Name]; ok {
+			return scalar, nil
+		}
+		return t.Name, nil
+	default:
+		return "", fmt.Errorf("unsupported type %s", types.ExprString(expr))
+	}
+}
+
+func getTemplateText() string {
+	return `//
+// Generated by grpcGen -- DO NOT EDIT
+//
+syntax = "proto3";
+
+package {{ .PackageName }}_pb;
+
+import "google/protobuf/struct.proto";
+{{ if .HasHTTP }}import "google/api/annotations.proto";
+{{ end }}
+{{ range $key, $value := .Services }}
+service {{ $key }} {
+  {{ range $value }}
+  rpc {{ .Name }} ({{ if .InStream }}stream {{ end }}{{ .In }}) returns ({{ if .OutStream }}stream {{ end }}{{ .Out }}) {{ if .HTTP }}{
+    option (google.api.http) = {
+      {{ lower .HTTP.Method }}: "{{ .HTTP.Pattern }}"
+      {{ if .HTTP.Body }}body: "{{ .HTTP.Body }}"
+      {{ end }}
+    };
+  }{{ else }}{}{{ end }}
+  {{ end }}
+}
+{{ end }}
+
+{{ range $key, $value := .Messages }}
+message {{ $key }} {
+  {{ range $value.Reserved }}reserved {{ . }};
+  {{ end }}
+  {{ range plainFields $value.Members }}
+  {{ if .Optional }}optional {{ end }}{{ .Type }} {{ .Name }} = {{ .Tag }}{{ if .Deprecated }} [deprecated=true]{{ end }};
+  {{ end }}
+  {{ range oneofGroups $value.Members }}
+  oneof {{ .Name }} {
+    {{ range .Members }}{{ .Type }} {{ .Name }} = {{ .Tag }}{{ if .Deprecated }} [deprecated=true]{{ end }};
+    {{ end }}
+  }
+  {{ end }}
+}
+{{ end }}`
+}
+
+func getExampleText(path string) string {
+	return fmt.Sprintf(`import (
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	pb "%s/pb"
+)
+
+// @grpcGen:Message
+type Request struct {
+	InEditMe1    string
+}
+
+// @grpcGen:Message
+type Reply struct {
+	OutEditMe1    string
+}
+
+// @grpcGen:Service
+// @grpcGen:SrvName: EditMe
+func (q *server) FuncEditMe1(ctx context.Context, in *pb.Request) (out *pb.Reply, err error) {
+	return &pb.Reply{OutEditMe1: "Hello " + in.InEditMe1}, nil
+}
+
+// @grpcGen:Service
+//@grpcGen:SrvName: EditMe
+func (s *server) FuncEditMe2(ctx context.Context, in *pb.Request) (out *pb.Reply, err error) {
+	return &pb.Reply{OutEditMe1: "Hey " + in.InEditMe1}, nil
+}`, path)
+}
@@ -0,0 +1,604 @@
+package grpcgen
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCorrectTypes(t *testing.T) {
+	src := `
+package grpc_test
+// @grpcGen:Message
+type Test struct {
+	Age      uint
+	Name     []byte
+	Money    int
+	Account  []string
+	TMap     map[string]*Bar
+	PointerS *Bar
+	Void     interface{}
+	VoidMap  map[string]interface{}
+	Bars     []*Foo
+}`
+	expect := []*MsgMember{
+		{Name: "Age", Type: "uint32"},
+		{Name: "Name", Type: "bytes"},
+		{Name: "Money", Type: "int32"},
+		{Name: "Account", Type: "repeated string"},
+		{Name: "TMap", Type: "map<string, Bar>"},
+		{Name: "PointerS", Type: "Bar"},
+		{Name: "Void", Type: "google.protobuf.Value"},
+		{Name: "VoidMap", Type: "map<string, google.protobuf.Value>"},
+		{Name: "Bars", Type: "repeated Foo"},
+	}
+	actuals := parseMsgMembers(t, src)
+	msgs := map[string]*Msg{"Test": {Name: "Test", Members: actuals}}
+	if err := correctTypes(msgs); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(expect); i++ {
+		if expect[i].Name != actuals[i].Name {
+			t.Errorf("name -> expect:%q, actual:%q", expect[i].Name, actuals[i].Name)
+		}
+		if expect[i].Type != actuals[i].Type {
+			t.Errorf("type -> expect:%q, actual:%q", expect[i].Type, actuals[i].Type)
+		}
+	}
+}
+
+func TestCorrectTypesNestedArrayError(t *testing.T) {
+	src := `
+package grpc_test
+// @grpcGen:Message
+type Test struct {
+	Matrix [][]int
+}`
+	msgs := map[string]*Msg{"Test": {Name: "Test", Members: parseMsgMembers(t, src)}}
+	if err := correctTypes(msgs); err == nil {
+		t.Errorf("expected repeated-of-repeated to be rejected")
+	}
+}
+
+func TestCorrectTypesInvalidNestedContainers(t *testing.T) {
+	cases := []struct {
+		name string
+		src  string
+	}{
+		{
+			name: "map value repeated",
+			src: `
+package grpc_test
+// @grpcGen:Message
+type Test struct {
+	ListMap map[string][]*Bar
+}`,
+		},
+		{
+			name: "map value map",
+			src: `
+package grpc_test
+// @grpcGen:Message
+type Test struct {
+	MapMap map[string]map[string]int
+}`,
+		},
+		{
+			name: "array of map",
+			src: `
+package grpc_test
+// @grpcGen:Message
+type Test struct {
+	MapList []map[string]int
+}`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			msgs := map[string]*Msg{"Test": {Name: "Test", Members: parseMsgMembers(t, c.src)}}
+			if err := correctTypes(msgs); err == nil {
+				t.Errorf("expected %s to be rejected as invalid proto3", c.name)
+			}
+		})
+	}
+}
+
+// parseMsgMembers parses src's single @grpcGen:Message declaration and
+// returns its members, as fetchMsg would during normal generation.
+func parseMsgMembers(t *testing.T, src string) []*MsgMember {
+	t.Helper()
+	return parseMsg(t, src).Members
+}
+
+// parseMsg parses src's single @grpcGen:Message declaration and returns the
+// resulting Msg, as fetchMsg would during normal generation.
+func parseMsg(t *testing.T, src string) *Msg {
+	t.Helper()
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	genDecl, ok := f.Decls[0].(*ast.GenDecl)
+	if !ok {
+		t.Fatal("decl[0] cannot be converted into GenDecl")
+	}
+	msg, err := fetchMsg(genDecl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestFetchMsgFieldAnnotations(t *testing.T) {
+	src := `
+package grpc_test
+// @grpcGen:Message
+// @grpcGen:Reserved: 4,6-8
+type Test struct {
+	Name string ` + "`pb:\"1\"`" + `
+	// @grpcGen:Optional
+	Nickname string ` + "`pb:\"2\"`" + `
+	// @grpcGen:Oneof: contact
+	Email string ` + "`pb:\"9\"`" + `
+	// @grpcGen:Oneof: contact
+	Phone string ` + "`pb:\"10\"`" + `
+	Legacy string ` + "`pb:\"3,deprecated\"`" + `
+}`
+	msg := parseMsg(t, src)
+	if len(msg.Reserved) != 2 || msg.Reserved[0].String() != "4" || msg.Reserved[1].String() != "6 to 8" {
+		t.Fatalf("unexpected reserved ranges: %+v", msg.Reserved)
+	}
+	byName := make(map[string]*MsgMember, len(msg.Members))
+	for _, m := range msg.Members {
+		byName[m.Name] = m
+	}
+	if !byName["Nickname"].Optional {
+		t.Errorf("expected Nickname to be optional")
+	}
+	if byName["Email"].OneofGroup != "contact" || byName["Phone"].OneofGroup != "contact" {
+		t.Errorf("expected Email and Phone to share the contact oneof group")
+	}
+	if !byName["Legacy"].Deprecated || byName["Legacy"].Tag != 3 {
+		t.Errorf("expected Legacy to be deprecated with tag 3, got %+v", byName["Legacy"])
+	}
+}
+
+func TestAssignFieldTags(t *testing.T) {
+	src := `
+package grpc_test
+// @grpcGen:Message
+// @grpcGen:Reserved: 2
+type Test struct {
+	First  string
+	Second string ` + "`pb:\"4\"`" + `
+	Third  string
+}`
+	msgs := map[string]*Msg{"Test": parseMsg(t, src)}
+	if err := assignFieldTags(msgs); err != nil {
+		t.Fatal(err)
+	}
+	members := msgs["Test"].Members
+	if members[0].Tag != 1 {
+		t.Errorf("First: expect tag 1, got %d", members[0].Tag)
+	}
+	if members[1].Tag != 4 {
+		t.Errorf("Second: expect tag 4, got %d", members[1].Tag)
+	}
+	if members[2].Tag != 3 {
+		t.Errorf("Third: expect tag 3 (skipping reserved 2), got %d", members[2].Tag)
+	}
+}
+
+func TestAssignFieldTagsCollision(t *testing.T) {
+	src := `
+package grpc_test
+// @grpcGen:Message
+type Test struct {
+	First  string ` + "`pb:\"1\"`" + `
+	Second string ` + "`pb:\"1\"`" + `
+}`
+	msgs := map[string]*Msg{"Test": parseMsg(t, src)}
+	if err := assignFieldTags(msgs); err == nil {
+		t.Errorf("expected a collision error for two fields sharing tag 1")
+	}
+}
+
+func TestFetchMsg(t *testing.T) {
+	src := `
+package grpc_test
+// @grpcGen:Message
+type Reply struct {
+        Name    string
+        Email   string
+        Counter int32
+}`
+	expect := []*Msg{
+		{
+			Name: "Reply",
+			Members: []*MsgMember{
+				{Name: "Name", Type: "string"},
+				{Name: "Email", Type: "string"},
+				{Name: "Counter", Type: "int32"},
+			},
+		},
+	}
+	actual := []*Msg{}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, decl := range f.Decls {
+		if genDecl, ok := decl.(*ast.GenDecl); ok {
+			if msg, err := fetchMsg(genDecl); err == nil {
+				actual = append(actual, msg)
+			} else {
+				t.Errorf("decl[%d] fetchMsg: %q", i, err)
+			}
+		} else {
+			t.Errorf("decl[%d] cannot be converted into GenDecl", i)
+		}
+	}
+	for _, msg := range actual {
+		for _, member := range msg.Members {
+			member.Expr = nil
+		}
+	}
+	if !reflect.DeepEqual(expect, actual) {
+		t.Errorf("actual and expect are not the same")
+	}
+}
+
+func TestFetchSrvStream(t *testing.T) {
+	src := `
+package grpc_test
+// @grpcGen:Stream: server
+// @grpcGen:Service
+// @grpcGen:SrvName: Greeting
+func (q *server) SayHello(ctx context.Context, in *pb.Request, out chan<- *pb.Reply) error {
+	return nil
+}
+// @grpcGen:Stream: client
+// @grpcGen:Service
+// @grpcGen:SrvName: Greeting
+func (q *server) SayYa(ctx context.Context, in <-chan *pb.Request) (out *pb.Reply, err error) {
+	return &pb.Reply{}, nil
+}`
+	expect := map[string][]*SrvFunc{
+		"Greeting": []*SrvFunc{
+			{Name: "SayHello", In: "Request", Out: "Reply", OutStream: true},
+			{Name: "SayYa", In: "Request", Out: "Reply", InStream: true},
+		},
+	}
+	actual := make(map[string][]*SrvFunc)
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, decl := range f.Decls {
+		if funcDecl, ok := decl.(*ast.FuncDecl); ok {
+			if srv, err := fetchSrv(funcDecl); err == nil {
+				actual[srv.Name] = append(actual[srv.Name], srv.Funcs)
+			} else {
+				t.Errorf("decl[%d] fetchSrv: %q", i, err)
+			}
+		} else {
+			t.Errorf("decl[%d] cannot be converted into FuncDecl", i)
+		}
+	}
+	if !reflect.DeepEqual(expect, actual) {
+		t.Errorf("actual and expect are not the same")
+	}
+}
+
+func TestFetchSrvStreamStub(t *testing.T) {
+	src := `
+package grpc_test
+// @grpcGen:Stream: server Reply
+// @grpcGen:Service
+// @grpcGen:SrvName: Greeting
+func (q *server) Sub(in *pb.Request, stream pb.Greeting_SubServer) error {
+	return nil
+}`
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	funcDecl, ok := f.Decls[0].(*ast.FuncDecl)
+	if !ok {
+		t.Fatal("decl[0] cannot be converted into FuncDecl")
+	}
+	srv, err := fetchSrv(funcDecl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := &SrvFunc{Name: "Sub", In: "Request", Out: "Reply", OutStream: true}
+	if !reflect.DeepEqual(expect, srv.Funcs) {
+		t.Errorf("expect:%+v, actual:%+v", expect, srv.Funcs)
+	}
+}
+
+func TestFetchSrvStreamStubMissingMessageName(t *testing.T) {
+	src := `
+package grpc_test
+// @grpcGen:Stream: server
+// @grpcGen:Service
+// @grpcGen:SrvName: Greeting
+func (q *server) Sub(in *pb.Request, stream pb.Greeting_SubServer) error {
+	return nil
+}`
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	funcDecl, ok := f.Decls[0].(*ast.FuncDecl)
+	if !ok {
+		t.Fatal("decl[0] cannot be converted into FuncDecl")
+	}
+	if _, err := fetchSrv(funcDecl); err == nil {
+		t.Error("expected an error when a stream stub parameter has no explicit reply message name")
+	}
+}
+
+func TestFetchSrvHTTP(t *testing.T) {
+	src := `
+package grpc_test
+// @grpcGen:HTTP: GET /v1/greet/{name}
+// @grpcGen:Service
+// @grpcGen:SrvName: Greeting
+func (q *server) SayHello(ctx context.Context, in *pb.Request) (out *pb.Reply, err error) {
+	return &pb.Reply{}, nil
+}
+// @grpcGen:HTTP: POST /v1/greet Body: *
+// @grpcGen:Service
+// @grpcGen:SrvName: Greeting
+func (q *server) SayYa(ctx context.Context, in *pb.Request) (out *pb.Reply, err error) {
+	return &pb.Reply{}, nil
+}`
+	expect := map[string]*HTTPRule{
+		"SayHello": {
+			Method:   "GET",
+			Pattern:  "/v1/greet/{name}",
+			Segments: []PathSegment{{Literal: "v1"}, {Literal: "greet"}, {Var: "name"}},
+		},
+		"SayYa": {
+			Method:   "POST",
+			Pattern:  "/v1/greet",
+			Body:     "*",
+			Segments: []PathSegment{{Literal: "v1"}, {Literal: "greet"}},
+		},
+	}
+	actual := make(map[string]*HTTPRule)
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, decl := range f.Decls {
+		if funcDecl, ok := decl.(*ast.FuncDecl); ok {
+			if srv, err := fetchSrv(funcDecl); err == nil {
+				actual[srv.Funcs.Name] = srv.Funcs.HTTP
+			} else {
+				t.Errorf("decl[%d] fetchSrv: %q", i, err)
+			}
+		} else {
+			t.Errorf("decl[%d] cannot be converted into FuncDecl", i)
+		}
+	}
+	if !reflect.DeepEqual(expect, actual) {
+		t.Errorf("actual and expect are not the same")
+	}
+}
+
+func TestValidateHTTPRulesUnknownField(t *testing.T) {
+	msgs := map[string]*Msg{
+		"Request": {Name: "Request", Members: []*MsgMember{{Name: "Name", Type: "string"}}},
+	}
+	srvs := map[string][]*SrvFunc{
+		"Greeting": {
+			{
+				Name: "SayHello",
+				In:   "Request",
+				HTTP: &HTTPRule{
+					Method:   "GET",
+					Pattern:  "/v1/greet/{missing}",
+					Segments: []PathSegment{{Literal: "v1"}, {Literal: "greet"}, {Var: "missing"}},
+				},
+			},
+		},
+	}
+	if err := validateHTTPRules(msgs, srvs); err == nil {
+		t.Errorf("expected an error for a path variable missing from the request message")
+	}
+}
+
+func TestFetchSrv(t *testing.T) {
+	src := `
+package grpc_test
+// @grpcGen:Service
+// @grpcGen:SrvName: Greeting
+func (q *server) SayHello(ctx context.Context, in *pb.Request) (out *pb.Reply, err error) {
+	return &pb.Reply{Message: "Hello " + in.Name}, nil
+}
+// @grpcGen:Service
+// @grpcGen:SrvName: Greeting
+func (q *server) SayYa(ctx context.Context, in *pb.Request) (out *pb.Reply, err error) {
+	return &pb.Reply{Message: "Ya " + in.Name}, nil
+}`
+	expect := map[string][]*SrvFunc{
+		"Greeting": []*SrvFunc{
+			{Name: "SayHello", In: "Request", Out: "Reply"},
+			{Name: "SayYa", In: "Request", Out: "Reply"},
+		},
+	}
+	actual := make(map[string][]*SrvFunc)
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, decl := range f.Decls {
+		if funcDecl, ok := decl.(*ast.FuncDecl); ok {
+			if srv, err := fetchSrv(funcDecl); err == nil {
+				actual[srv.Name] = append(actual[srv.Name], srv.Funcs)
+			} else {
+				t.Errorf("decl[%d] fetchSrv: %q", i, err)
+			}
+		} else {
+			t.Errorf("decl[%d] cannot be converted into FuncDecl", i)
+		}
+	}
+	if !reflect.DeepEqual(expect, actual) {
+		t.Errorf("actual and expect are not the same")
+	}
+}
+
+// TestResolveReferencesUnknownMessage exercises loadPackage end to end
+// against a real one-file module whose service references a message that is
+// never declared, and asserts the reported error carries that function's
+// file:line, as resolveReferences promises.
+func TestResolveReferencesUnknownMessage(t *testing.T) {
+	dir := t.TempDir()
+	goMod := "module grpcgentest\n\ngo 1.21\n"
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(goMod), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	src := `package grpcgentest
+
+// @grpcGen:Service
+// @grpcGen:SrvName: Greeting
+func (s *server) SayHello(in *pb.Request) (out *pb.Reply, err error) {
+	return nil, nil
+}
+`
+	srcPath := filepath.Join(dir, "service.go")
+	if err := os.WriteFile(srcPath, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	fset, _, files, _, err := loadPackage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srvs := map[string][]*SrvFunc{}
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			funcDecl, ok := decl.(*ast.FuncDecl)
+			if !ok || funcDecl.Doc == nil {
+				continue
+			}
+			srv, err := fetchSrv(funcDecl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if srv != nil {
+				srvs[srv.Name] = append(srvs[srv.Name], srv.Funcs)
+			}
+		}
+	}
+
+	err = resolveReferences(fset, files, map[string]*Msg{}, srvs)
+	if err == nil {
+		t.Fatal("expected an error for a service referencing an undeclared message")
+	}
+	wantPos := "service.go:5:1"
+	if !strings.Contains(err.Error(), wantPos) {
+		t.Errorf("expected error to contain file:line %q, got %q", wantPos, err.Error())
+	}
+	if !strings.Contains(err.Error(), `"Request"`) {
+		t.Errorf("expected error to name the unresolved message, got %q", err.Error())
+	}
+}
+
+// TestRegisterPluginAndGenerate exercises the public plugin API end to end:
+// a custom plugin registered via RegisterPlugin is invoked by Generate with
+// a Generator populated from a real package on disk.
+func TestRegisterPluginAndGenerate(t *testing.T) {
+	dir := t.TempDir()
+	goMod := "module grpcgentest\n\ngo 1.21\n"
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(goMod), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	src := `package grpcgentest
+
+// @grpcGen:Message
+type Request struct {
+	Name string
+}
+
+// @grpcGen:Message
+type Reply struct {
+	Message string
+}
+
+// @grpcGen:Service
+// @grpcGen:SrvName: Greeting
+func (s *server) SayHello(in *pb.Request) (out *pb.Reply, err error) {
+	return nil, nil
+}
+`
+	if err := os.WriteFile(filepath.Join(dir, "service.go"), []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var got *Generator
+	RegisterPlugin("test-plugin", func(gen *Generator) error {
+		got = gen
+		return nil
+	})
+	t.Cleanup(func() { delete(plugins, "test-plugin") })
+
+	if err := Generate(dir, []string{"test-plugin"}, false, false); err != nil {
+		t.Fatal(err)
+	}
+	if got == nil {
+		t.Fatal("expected the registered plugin to run")
+	}
+	if _, ok := got.Messages["Request"]; !ok {
+		t.Errorf("expected Generator.Messages to contain Request, got %+v", got.Messages)
+	}
+	if _, ok := got.Messages["Reply"]; !ok {
+		t.Errorf("expected Generator.Messages to contain Reply, got %+v", got.Messages)
+	}
+	funcs, ok := got.Services["Greeting"]
+	if !ok || len(funcs) != 1 || funcs[0].Name != "SayHello" {
+		t.Errorf("expected Generator.Services[\"Greeting\"] to contain SayHello, got %+v", got.Services)
+	}
+}
+
+func TestGenerateUnknownPlugin(t *testing.T) {
+	dir := t.TempDir()
+	goMod := "module grpcgentest\n\ngo 1.21\n"
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(goMod), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	src := `package grpcgentest
+
+// @grpcGen:Message
+type Request struct {
+	Name string
+}
+
+// @grpcGen:Service
+// @grpcGen:SrvName: Greeting
+func (s *server) SayHello(in *pb.Request) (err error) {
+	return nil
+}
+`
+	if err := os.WriteFile(filepath.Join(dir, "service.go"), []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Generate(dir, []string{"does-not-exist"}, false, false); err == nil {
+		t.Error("expected an error for an unregistered plugin name")
+	}
+}